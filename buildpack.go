@@ -0,0 +1,119 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"os"
+	"reflect"
+)
+
+// BuildpackDependencyLicense represents a license that a BuildpackDependency is distributed under.
+type BuildpackDependencyLicense struct {
+
+	// Type is the type of the license. This is typically the SPDX short identifier.
+	Type string `toml:"type" mapstructure:"type"`
+
+	// URI is the location where the license can be found.
+	URI string `toml:"uri" mapstructure:"uri"`
+}
+
+// BuildpackDependency describes a dependency known to the buildpack.
+type BuildpackDependency struct {
+
+	// ID is the dependency ID.
+	ID string `toml:"id"`
+
+	// Name is the dependency name.
+	Name string `toml:"name"`
+
+	// Version is the dependency version.
+	Version string `toml:"version"`
+
+	// URI is the dependency URI.
+	URI string `toml:"uri"`
+
+	// SHA256 is the hash of the dependency.
+	SHA256 string `toml:"sha256"`
+
+	// CPEs are the CPE 2.3 URIs identifying the dependency, used by NVDDependencyScanner to match it against a
+	// local NVD feed.
+	CPEs []string `toml:"cpes"`
+
+	// Stacks are the stacks the dependency is compatible with.
+	Stacks []string `toml:"stacks"`
+
+	// Licenses are the licenses the dependency is distributed under.
+	Licenses []BuildpackDependencyLicense `toml:"licenses"`
+
+	// Metadata holds dependency-specific extensions, e.g. the "layer-media-type"/"layer-index" keys OCIArtifact uses
+	// to pick a layer out of an oci:// reference.
+	Metadata map[string]interface{} `toml:"metadata"`
+
+	// Variants are the alternative distributions of this dependency, keyed by a name meaningful to the buildpack
+	// (e.g. "linux-arm64"), that ResolveDependencyVariant picks between.
+	Variants map[string]DependencyVariant `toml:"variants"`
+}
+
+// Equals compares two BuildpackDependency instances, ignoring Metadata and Variants, which are free-form and not
+// part of a dependency's identity for cache-reuse purposes.
+func (b BuildpackDependency) Equals(o BuildpackDependency) bool {
+	b.Metadata, o.Metadata = nil, nil
+	b.Variants, o.Variants = nil, nil
+	return reflect.DeepEqual(b, o)
+}
+
+// BuildpackConfiguration represents a build or launch configuration parameter.
+type BuildpackConfiguration struct {
+
+	// Build indicates whether the configuration is for build-time. Optional.
+	Build bool `toml:"build"`
+
+	// Default is the default value of the configuration parameter. Optional.
+	Default string `toml:"default"`
+
+	// Description is the description of the configuration parameter.
+	Description string `toml:"description"`
+
+	// Launch indicates whether the configuration is for launch-time. Optional.
+	Launch bool `toml:"launch"`
+
+	// Name is the environment variable name of the configuration parameter.
+	Name string `toml:"name"`
+}
+
+// ConfigurationResolver provides functionality for resolving a configuration value.
+type ConfigurationResolver struct {
+
+	// Configurations are the configurations to resolve against.
+	Configurations []BuildpackConfiguration
+}
+
+// Resolve resolves the value for a configuration option. The environment variable named name wins if set; otherwise
+// the configured default is returned with ok false.
+func (c ConfigurationResolver) Resolve(name string) (string, bool) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, ok
+	}
+
+	for _, c := range c.Configurations {
+		if c.Name == name {
+			return c.Default, false
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/heroku/color"
+
+	"github.com/paketoio/libpak/bard"
+)
+
+// DependencyCache allows a user to get an artifact either from a buildpack's cache, a previous download, or to
+// download it directly.
+type DependencyCache struct {
+
+	// CachePath is the location where the buildpack has cached its dependencies.
+	CachePath string
+
+	// DownloadPath is the location of all downloads during this execution of the build.
+	DownloadPath string
+
+	// Logger is the logger used to write to the console.
+	Logger bard.Logger
+
+	// UserAgent is the User-Agent string to use with requests.
+	UserAgent string
+}
+
+// Artifact returns the dependency's artifact. An oci:// dependency.URI is resolved via OCIArtifact instead;
+// otherwise resolution follows three tiers:
+//
+//  1. CachePath
+//  2. DownloadPath
+//  3. Download from URI
+//
+// If dependency.SHA256 is not set, the download can never be verified to be up to date and will always download,
+// skipping both caches. This applies to the oci:// path too: OCIArtifact still verifies the layer digest if
+// dependency.SHA256 is set, but there is no cache tier to skip, since OCIArtifact never writes into CachePath or
+// DownloadPath.
+func (d DependencyCache) Artifact(dependency BuildpackDependency) (*os.File, error) {
+	if IsOCIDependency(dependency) {
+		artifact, _, _, err := ociArtifactToTempFile(dependency)
+		return artifact, err
+	}
+
+	if dependency.SHA256 == "" {
+		d.Logger.Bodyf("%s dependency has no SHA256, skipping cache", color.YellowString("Warning:"))
+		return d.downloadTo(dependency, filepath.Join(d.DownloadPath, filepath.Base(dependency.URI)))
+	}
+
+	if cached, ok := d.cached(d.CachePath, dependency); ok {
+		d.Logger.Bodyf("%s cached download from buildpack", color.GreenString("Reusing"))
+		return cached, nil
+	}
+
+	if cached, ok := d.cached(d.DownloadPath, dependency); ok {
+		d.Logger.Bodyf("%s previously cached download", color.GreenString("Reusing"))
+		return cached, nil
+	}
+
+	artifact := filepath.Join(d.DownloadPath, dependency.SHA256, filepath.Base(dependency.URI))
+	file, err := d.downloadTo(dependency, artifact)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.verify(artifact, dependency.SHA256); err != nil {
+		return nil, err
+	}
+
+	metadata := filepath.Join(d.DownloadPath, fmt.Sprintf("%s.toml", dependency.SHA256))
+	if err := d.writeMetadata(metadata, dependency); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// cached reports whether root/<dependency.SHA256>.toml describes dependency, and if so, opens
+// root/<dependency.SHA256>/<basename of URI>.
+func (d DependencyCache) cached(root string, dependency BuildpackDependency) (*os.File, bool) {
+	metadata := filepath.Join(root, fmt.Sprintf("%s.toml", dependency.SHA256))
+
+	var actual BuildpackDependency
+	if _, err := toml.DecodeFile(metadata, &actual); err != nil {
+		return nil, false
+	}
+
+	if !dependency.Equals(actual) {
+		return nil, false
+	}
+
+	in, err := os.Open(filepath.Join(root, dependency.SHA256, filepath.Base(dependency.URI)))
+	if err != nil {
+		return nil, false
+	}
+
+	return in, true
+}
+
+func (d DependencyCache) writeMetadata(path string, dependency BuildpackDependency) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create %s: %w", filepath.Dir(path), err)
+	}
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", path, err)
+	}
+	defer out.Close()
+
+	if err := toml.NewEncoder(out).Encode(dependency); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (d DependencyCache) downloadTo(dependency BuildpackDependency, destination string) (*os.File, error) {
+	d.Logger.Bodyf("%s from %s", color.YellowString("Downloading"), dependency.URI)
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", filepath.Dir(destination), err)
+	}
+
+	u, err := url.Parse(dependency.URI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", dependency.URI, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request for %s: %w", dependency.URI, err)
+	}
+	if d.UserAgent != "" {
+		req.Header.Set("User-Agent", d.UserAgent)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request %s: %w", dependency.URI, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unable to download %s: status %d", dependency.URI, resp.StatusCode)
+	}
+
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", destination, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return nil, fmt.Errorf("unable to write %s: %w", destination, err)
+	}
+
+	return os.Open(destination)
+}
+
+func (DependencyCache) verify(path string, expected string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to verify %s: %w", path, err)
+	}
+	defer in.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, in); err != nil {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	if actual := hex.EncodeToString(sum.Sum(nil)); actual != expected {
+		return fmt.Errorf("sha256 for %s %s does not match expected %s", path, actual, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DependencySeverity is the severity of a DependencyFinding, ordered from least to most severe.
+type DependencySeverity string
+
+const (
+	SeverityNone     DependencySeverity = "none"
+	SeverityLow      DependencySeverity = "low"
+	SeverityMedium   DependencySeverity = "medium"
+	SeverityHigh     DependencySeverity = "high"
+	SeverityCritical DependencySeverity = "critical"
+)
+
+var severityOrder = map[DependencySeverity]int{
+	SeverityNone:     0,
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// atLeast reports whether s is at least as severe as threshold.
+func (s DependencySeverity) atLeast(threshold DependencySeverity) bool {
+	return severityOrder[s] >= severityOrder[threshold]
+}
+
+// DependencyFinding is a single vulnerability reported by a DependencyScanner.
+type DependencyFinding struct {
+
+	// ID is the scanner's identifier for the finding, e.g. a CVE ID.
+	ID string `json:"id" mapstructure:"id"`
+
+	// Severity is the finding's severity.
+	Severity DependencySeverity `json:"severity" mapstructure:"severity"`
+
+	// Description is a human readable description of the finding.
+	Description string `json:"description" mapstructure:"description"`
+
+	// Link is a URI with more information about the finding, if available.
+	Link string `json:"link,omitempty" mapstructure:"link"`
+}
+
+// DependencyScanner scans a dependency artifact for known vulnerabilities.
+type DependencyScanner interface {
+
+	// Scan returns the findings for artifact, described by dependency.
+	Scan(artifact *os.File, dependency BuildpackDependency) ([]DependencyFinding, error)
+}
+
+// DependencyScanSeverityEnvVar configures the minimum DependencySeverity that triggers DependencyScanModeEnvVar.
+const DependencyScanSeverityEnvVar = "BP_DEPENDENCY_SCAN_SEVERITY"
+
+// DependencyScanModeEnvVar configures whether findings at or above DependencyScanSeverityEnvVar fail the build
+// ("enforce", the default) or only emit a warning ("warn").
+const DependencyScanModeEnvVar = "BP_DEPENDENCY_SCAN_MODE"
+
+// DependencyScannerURLEnvVar configures the endpoint used by ClairDependencyScanner.
+const DependencyScannerURLEnvVar = "BP_DEPENDENCY_SCANNER_URL"
+
+// ScanDependency runs scanner against artifact, compares the results against the BP_DEPENDENCY_SCAN_SEVERITY
+// threshold, and either returns an error (BP_DEPENDENCY_SCAN_MODE=enforce, the default) or logs a warning
+// (BP_DEPENDENCY_SCAN_MODE=warn) for findings at or above the threshold. It returns every finding, along with a
+// stable digest of the result so callers can fold it into ExpectedMetadata and invalidate the layer cache when a
+// newly-disclosed CVE appears. A nil scanner is a no-op.
+func ScanDependency(scanner DependencyScanner, artifact *os.File, dependency BuildpackDependency, logger interface {
+	Header(string, ...interface{})
+}) ([]DependencyFinding, string, error) {
+	if scanner == nil {
+		return nil, "", nil
+	}
+
+	findings, err := scanner.Scan(artifact, dependency)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to scan %s: %w", dependency.ID, err)
+	}
+
+	digest, err := findingsDigest(findings)
+	if err != nil {
+		return nil, "", err
+	}
+
+	threshold := DependencySeverity(os.Getenv(DependencyScanSeverityEnvVar))
+	if threshold == "" {
+		threshold = SeverityCritical
+	}
+
+	var atOrAbove []DependencyFinding
+	for _, f := range findings {
+		if f.Severity.atLeast(threshold) {
+			atOrAbove = append(atOrAbove, f)
+		}
+	}
+
+	if len(atOrAbove) == 0 {
+		return findings, digest, nil
+	}
+
+	mode := os.Getenv(DependencyScanModeEnvVar)
+	if mode == "" {
+		mode = "enforce"
+	}
+
+	if mode == "warn" {
+		if logger != nil {
+			logger.Header("%s has %d finding(s) at or above severity %s", dependency.ID, len(atOrAbove), threshold)
+		}
+		return findings, digest, nil
+	}
+
+	return nil, "", fmt.Errorf("%s has %d finding(s) at or above severity %s", dependency.ID, len(atOrAbove), threshold)
+}
+
+// findingsDigest returns a stable sha256 of findings, for ExpectedMetadata.
+func findingsDigest(findings []DependencyFinding) (string, error) {
+	b, err := json.Marshal(findings)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal findings: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ClairDependencyScanner is a DependencyScanner that posts the artifact to a Clair-compatible v1 API. Clair fetches
+// the layer itself rather than accepting an upload, so this assumes dependency.URI is reachable from wherever Clair
+// runs (e.g. the same registry/mirror the build uses), not merely from inside the build container.
+type ClairDependencyScanner struct {
+
+	// URL is the base URL of the Clair API, e.g. http://clair:6060. Defaults to DependencyScannerURLEnvVar.
+	URL string
+
+	client *http.Client
+}
+
+// NewClairDependencyScanner creates a new instance configured from DependencyScannerURLEnvVar.
+func NewClairDependencyScanner() ClairDependencyScanner {
+	return ClairDependencyScanner{
+		URL:    os.Getenv(DependencyScannerURLEnvVar),
+		client: http.DefaultClient,
+	}
+}
+
+// clairSeverity maps Clair v1's severity vocabulary (Unknown|Negligible|Low|Medium|High|Critical|Defcon1) onto
+// DependencySeverity. Unknown and Negligible collapse to SeverityNone, and Defcon1 - Clair's highest severity,
+// above Critical - maps to SeverityCritical, the most severe tier DependencySeverity has. A value outside that
+// vocabulary (e.g. a future Clair release adding one) fails safe to SeverityCritical rather than silently scoring
+// as SeverityNone, since severityOrder treats any key it doesn't recognize as weight 0.
+func clairSeverity(severity string) DependencySeverity {
+	switch strings.ToLower(severity) {
+	case "unknown", "negligible":
+		return SeverityNone
+	case "low":
+		return SeverityLow
+	case "medium":
+		return SeverityMedium
+	case "high":
+		return SeverityHigh
+	case "critical", "defcon1":
+		return SeverityCritical
+	default:
+		return SeverityCritical
+	}
+}
+
+func (c ClairDependencyScanner) Scan(artifact *os.File, dependency BuildpackDependency) ([]DependencyFinding, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("%s must be set to use ClairDependencyScanner", DependencyScannerURLEnvVar)
+	}
+
+	layerReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/layers", c.URL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	layerReq.Header.Set("Content-Type", "application/json")
+
+	payload := struct {
+		Layer struct {
+			Name   string `json:"Name"`
+			Path   string `json:"Path"`
+			Format string `json:"Format"`
+		} `json:"Layer"`
+	}{}
+	payload.Layer.Name = dependency.SHA256
+	payload.Layer.Path = dependency.URI
+	payload.Layer.Format = "Docker"
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal request: %w", err)
+	}
+	layerReq.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp, err := c.client.Do(layerReq)
+	if err != nil {
+		return nil, fmt.Errorf("unable to post layer to %s: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unable to post layer to %s: status %s", c.URL, resp.Status)
+	}
+
+	vulnResp, err := c.client.Get(fmt.Sprintf("%s/v1/layers/%s?vulnerabilities", c.URL, dependency.SHA256))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vulnerabilities from %s: %w", c.URL, err)
+	}
+	defer vulnResp.Body.Close()
+
+	var result struct {
+		Layer struct {
+			Features []struct {
+				Vulnerabilities []struct {
+					Name        string `json:"Name"`
+					Severity    string `json:"Severity"`
+					Description string `json:"Description"`
+					Link        string `json:"Link"`
+				} `json:"Vulnerabilities"`
+			} `json:"Features"`
+		} `json:"Layer"`
+	}
+	if err := json.NewDecoder(vulnResp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("unable to decode response from %s: %w", c.URL, err)
+	}
+
+	var findings []DependencyFinding
+	for _, feature := range result.Layer.Features {
+		for _, v := range feature.Vulnerabilities {
+			findings = append(findings, DependencyFinding{
+				ID:          v.Name,
+				Severity:    clairSeverity(v.Severity),
+				Description: v.Description,
+				Link:        v.Link,
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// NVDDependencyScanner is an offline DependencyScanner that matches dependency.CPEs against a local NVD feed file.
+type NVDDependencyScanner struct {
+
+	// FeedPath is the path to a local NVD JSON feed file.
+	FeedPath string
+}
+
+// NewNVDDependencyScanner creates a new instance reading from feedPath.
+func NewNVDDependencyScanner(feedPath string) NVDDependencyScanner {
+	return NVDDependencyScanner{FeedPath: feedPath}
+}
+
+func (n NVDDependencyScanner) Scan(artifact *os.File, dependency BuildpackDependency) ([]DependencyFinding, error) {
+	if len(dependency.CPEs) == 0 {
+		return nil, nil
+	}
+
+	in, err := os.Open(n.FeedPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", n.FeedPath, err)
+	}
+	defer in.Close()
+
+	var feed struct {
+		CVEItems []struct {
+			CVE struct {
+				CVEDataMeta struct {
+					ID string `json:"ID"`
+				} `json:"CVE_data_meta"`
+			} `json:"cve"`
+			Configurations struct {
+				Nodes []struct {
+					CPEMatch []struct {
+						CPE23URI string `json:"cpe23Uri"`
+					} `json:"cpe_match"`
+				} `json:"nodes"`
+			} `json:"configurations"`
+			Impact struct {
+				BaseMetricV3 struct {
+					CVSSV3 struct {
+						BaseSeverity string `json:"baseSeverity"`
+					} `json:"cvssV3"`
+				} `json:"baseMetricV3"`
+			} `json:"impact"`
+		} `json:"CVE_Items"`
+	}
+	if err := json.NewDecoder(in).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %w", n.FeedPath, err)
+	}
+
+	cpes := map[string]struct{}{}
+	for _, c := range dependency.CPEs {
+		cpes[c] = struct{}{}
+	}
+
+	var findings []DependencyFinding
+	for _, item := range feed.CVEItems {
+		for _, node := range item.Configurations.Nodes {
+			for _, match := range node.CPEMatch {
+				if _, ok := cpes[match.CPE23URI]; !ok {
+					continue
+				}
+
+				findings = append(findings, DependencyFinding{
+					ID:       item.CVE.CVEDataMeta.ID,
+					Severity: DependencySeverity(strings.ToLower(item.Impact.BaseMetricV3.CVSSV3.BaseSeverity)),
+				})
+			}
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/paketoio/libpak"
+)
+
+type stubDependencyScanner struct {
+	findings []libpak.DependencyFinding
+	err      error
+}
+
+func (s stubDependencyScanner) Scan(*os.File, libpak.BuildpackDependency) ([]libpak.DependencyFinding, error) {
+	return s.findings, s.err
+}
+
+func testDependencyScanner(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dependency libpak.BuildpackDependency
+		artifact   *os.File
+	)
+
+	it.Before(func() {
+		dependency = libpak.BuildpackDependency{ID: "test-dependency"}
+
+		var err error
+		artifact, err = os.CreateTemp("", "dependency-scanner-test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(artifact.Name())).To(Succeed())
+		Expect(os.Unsetenv(libpak.DependencyScanSeverityEnvVar)).To(Succeed())
+		Expect(os.Unsetenv(libpak.DependencyScanModeEnvVar)).To(Succeed())
+	})
+
+	context("ScanDependency", func() {
+		it("is a no-op for a nil scanner", func() {
+			findings, digest, err := libpak.ScanDependency(nil, artifact, dependency, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(BeNil())
+			Expect(digest).To(BeEmpty())
+		})
+
+		it("returns findings below the default critical threshold without error", func() {
+			scanner := stubDependencyScanner{findings: []libpak.DependencyFinding{
+				{ID: "CVE-2020-0001", Severity: libpak.SeverityMedium},
+			}}
+
+			findings, digest, err := libpak.ScanDependency(scanner, artifact, dependency, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(HaveLen(1))
+			Expect(digest).NotTo(BeEmpty())
+		})
+
+		it("fails the build for a finding at or above the configured severity in enforce mode (the default)", func() {
+			Expect(os.Setenv(libpak.DependencyScanSeverityEnvVar, "high")).To(Succeed())
+
+			scanner := stubDependencyScanner{findings: []libpak.DependencyFinding{
+				{ID: "CVE-2020-0002", Severity: libpak.SeverityCritical},
+			}}
+
+			_, _, err := libpak.ScanDependency(scanner, artifact, dependency, nil)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test-dependency"))
+		})
+
+		it("warns instead of failing when BP_DEPENDENCY_SCAN_MODE=warn", func() {
+			Expect(os.Setenv(libpak.DependencyScanSeverityEnvVar, "high")).To(Succeed())
+			Expect(os.Setenv(libpak.DependencyScanModeEnvVar, "warn")).To(Succeed())
+
+			scanner := stubDependencyScanner{findings: []libpak.DependencyFinding{
+				{ID: "CVE-2020-0003", Severity: libpak.SeverityCritical},
+			}}
+
+			findings, digest, err := libpak.ScanDependency(scanner, artifact, dependency, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(HaveLen(1))
+			Expect(digest).NotTo(BeEmpty())
+		})
+
+		it("propagates an error from the scanner", func() {
+			scanner := stubDependencyScanner{err: os.ErrInvalid}
+
+			_, _, err := libpak.ScanDependency(scanner, artifact, dependency, nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("produces a stable digest that changes when findings change", func() {
+			a := stubDependencyScanner{findings: []libpak.DependencyFinding{{ID: "CVE-1", Severity: libpak.SeverityLow}}}
+			b := stubDependencyScanner{findings: []libpak.DependencyFinding{{ID: "CVE-1", Severity: libpak.SeverityLow}}}
+			c := stubDependencyScanner{findings: []libpak.DependencyFinding{{ID: "CVE-2", Severity: libpak.SeverityLow}}}
+
+			_, digestA, err := libpak.ScanDependency(a, artifact, dependency, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, digestB, err := libpak.ScanDependency(b, artifact, dependency, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, digestC, err := libpak.ScanDependency(c, artifact, dependency, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(digestA).To(Equal(digestB))
+			Expect(digestA).NotTo(Equal(digestC))
+		})
+	})
+
+	context("ClairDependencyScanner", func() {
+		it("fails when BP_DEPENDENCY_SCANNER_URL is not set", func() {
+			scanner := libpak.NewClairDependencyScanner()
+
+			_, err := scanner.Scan(artifact, dependency)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(libpak.DependencyScannerURLEnvVar))
+		})
+
+		it("posts the dependency URI, not the local artifact path, to /v1/layers", func() {
+			dependency.URI = "https://dependencies.example.com/test-dependency.tgz"
+			dependency.SHA256 = "test-sha256"
+
+			var postedPath string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/v1/layers":
+					var payload struct {
+						Layer struct {
+							Path string `json:"Path"`
+						} `json:"Layer"`
+					}
+					Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+					postedPath = payload.Layer.Path
+					w.WriteHeader(http.StatusOK)
+				case r.Method == http.MethodGet:
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`{"Layer":{"Features":[]}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			Expect(os.Setenv(libpak.DependencyScannerURLEnvVar, server.URL)).To(Succeed())
+			defer func() { Expect(os.Unsetenv(libpak.DependencyScannerURLEnvVar)).To(Succeed()) }()
+
+			scanner := libpak.NewClairDependencyScanner()
+			findings, err := scanner.Scan(artifact, dependency)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(BeEmpty())
+			Expect(postedPath).To(Equal(dependency.URI))
+		})
+
+		it("maps Clair's Defcon1 severity to SeverityCritical instead of the Go zero value", func() {
+			dependency.URI = "https://dependencies.example.com/test-dependency.tgz"
+			dependency.SHA256 = "test-sha256"
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/v1/layers":
+					w.WriteHeader(http.StatusOK)
+				case r.Method == http.MethodGet:
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`{"Layer":{"Features":[{"Vulnerabilities":[
+						{"Name":"CVE-2020-9999","Severity":"Defcon1"}
+					]}]}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			Expect(os.Setenv(libpak.DependencyScannerURLEnvVar, server.URL)).To(Succeed())
+			defer func() { Expect(os.Unsetenv(libpak.DependencyScannerURLEnvVar)).To(Succeed()) }()
+
+			scanner := libpak.NewClairDependencyScanner()
+			findings, err := scanner.Scan(artifact, dependency)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(HaveLen(1))
+			Expect(findings[0].Severity).To(Equal(libpak.SeverityCritical))
+
+			_, _, err = libpak.ScanDependency(scanner, artifact, dependency, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
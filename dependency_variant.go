@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/buildpacks/libcnb"
+)
+
+// DependencyVariant is a single distribution of a BuildpackDependency, e.g. the linux-arm64 binary of a JDK, or the
+// mvnd binary alongside mvn.
+type DependencyVariant struct {
+
+	// URI is the location of the dependency variant.
+	URI string `mapstructure:"uri"`
+
+	// SHA256 is the SHA256 hash of the dependency variant.
+	SHA256 string `mapstructure:"sha256"`
+
+	// Stacks are the stacks the dependency variant is compatible with.
+	Stacks []string `mapstructure:"stacks"`
+
+	// OS constrains the variant to a particular GOOS, e.g. "linux". Empty matches any OS.
+	OS string `mapstructure:"os"`
+
+	// Arch constrains the variant to a particular GOARCH, e.g. "arm64". Empty matches any architecture.
+	Arch string `mapstructure:"arch"`
+}
+
+// matches reports whether v is usable on the current runtime.
+func (v DependencyVariant) matches() bool {
+	return (v.OS == "" || v.OS == runtime.GOOS) && (v.Arch == "" || v.Arch == runtime.GOARCH)
+}
+
+// variantEnvVar derives the BP_<ID>_VARIANT configuration name for dependencyID, upper-casing it and replacing
+// hyphens with underscores so ids like "bellsoft-jdk" produce a settable BP_BELLSOFT_JDK_VARIANT, matching the
+// BP_MAVEN_COMMAND-style convention used elsewhere.
+func variantEnvVar(dependencyID string) string {
+	return fmt.Sprintf("BP_%s_VARIANT", strings.ToUpper(strings.ReplaceAll(dependencyID, "-", "_")))
+}
+
+// ResolveDependencyVariant picks a key into dependency.Variants, in order of preference:
+//
+//  1. explicitKey, if non-empty
+//  2. the value of configuration, whether it comes from an environment variable or a configured Default, if present
+//     in dependency.Variants (mirroring the BP_MAVEN_COMMAND pattern, where a configured default selects the binary
+//     distributed without requiring an environment variable override)
+//  3. the sole variant whose OS/Arch constraints match the current runtime
+//
+// It returns the selected key and DependencyVariant.
+func ResolveDependencyVariant(dependency BuildpackDependency, explicitKey string, configuration ConfigurationResolver) (string, DependencyVariant, error) {
+	if len(dependency.Variants) == 0 {
+		return "", DependencyVariant{}, fmt.Errorf("%s has no variants", dependency.ID)
+	}
+
+	if explicitKey != "" {
+		variant, ok := dependency.Variants[explicitKey]
+		if !ok {
+			return "", DependencyVariant{}, fmt.Errorf("%s has no variant %q", dependency.ID, explicitKey)
+		}
+		return explicitKey, variant, nil
+	}
+
+	if key, ok := configuration.Resolve(variantEnvVar(dependency.ID)); key != "" {
+		if variant, found := dependency.Variants[key]; found {
+			return key, variant, nil
+		}
+		if ok {
+			return "", DependencyVariant{}, fmt.Errorf("%s has no variant %q", dependency.ID, key)
+		}
+		// an env var names an unknown variant and fails fast above; a configured Default naming an unknown variant
+		// falls through to auto-detection instead, since the buildpack author may not control it.
+	}
+
+	var matchKey string
+	var matchCount int
+	for key, variant := range dependency.Variants {
+		if variant.matches() {
+			matchKey = key
+			matchCount++
+		}
+	}
+
+	if matchCount != 1 {
+		return "", DependencyVariant{}, fmt.Errorf("unable to auto-detect a unique variant of %s for %s/%s", dependency.ID, runtime.GOOS, runtime.GOARCH)
+	}
+
+	return matchKey, dependency.Variants[matchKey], nil
+}
+
+// NewDependencyLayerContributorForVariant is like NewDependencyLayerContributor, but resolves variantKey (an
+// explicit key, a ConfigurationResolver value, or runtime auto-detection) into a DependencyVariant and contributes
+// that variant's URI/SHA256/Stacks instead of the dependency's own. The chosen variant's key and digest participate
+// in ExpectedMetadata, and the BuildpackPlan entry metadata records which variant was resolved, so switching
+// variants invalidates the layer.
+func NewDependencyLayerContributorForVariant(dependency BuildpackDependency, variantKey string, configuration ConfigurationResolver,
+	cache DependencyCache, layer libcnb.Layer, plan *libcnb.BuildpackPlan) (DependencyLayerContributor, error) {
+
+	key, variant, err := ResolveDependencyVariant(dependency, variantKey, configuration)
+	if err != nil {
+		return DependencyLayerContributor{}, fmt.Errorf("unable to resolve variant for %s: %w", dependency.ID, err)
+	}
+
+	resolved := dependency
+	resolved.URI = variant.URI
+	resolved.SHA256 = variant.SHA256
+	resolved.Stacks = variant.Stacks
+
+	contributor := NewDependencyLayerContributor(resolved, cache, layer, plan)
+	contributor.LayerContributor.ExpectedMetadata["variant"] = key
+
+	plan.Entries[len(plan.Entries)-1].Metadata["variant"] = key
+
+	return contributor, nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/libcnb"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/paketoio/libpak"
+)
+
+func testDependencyVariant(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dependency    libpak.BuildpackDependency
+		configuration libpak.ConfigurationResolver
+	)
+
+	it.Before(func() {
+		dependency = libpak.BuildpackDependency{
+			ID: "bellsoft-jdk",
+			Variants: map[string]libpak.DependencyVariant{
+				"linux-amd64": {URI: "https://example.com/amd64.tgz", SHA256: "amd64-sha", OS: "linux", Arch: "amd64"},
+				"linux-arm64": {URI: "https://example.com/arm64.tgz", SHA256: "arm64-sha", OS: "linux", Arch: "arm64"},
+			},
+		}
+		configuration = libpak.ConfigurationResolver{}
+	})
+
+	it.After(func() {
+		Expect(os.Unsetenv("BP_BELLSOFT_JDK_VARIANT")).To(Succeed())
+	})
+
+	context("ResolveDependencyVariant", func() {
+		it("fails when the dependency has no variants", func() {
+			_, _, err := libpak.ResolveDependencyVariant(libpak.BuildpackDependency{ID: "no-variants"}, "", configuration)
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("picks the explicit key when given", func() {
+			key, variant, err := libpak.ResolveDependencyVariant(dependency, "linux-arm64", configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal("linux-arm64"))
+			Expect(variant.SHA256).To(Equal("arm64-sha"))
+		})
+
+		it("fails when the explicit key does not exist", func() {
+			_, _, err := libpak.ResolveDependencyVariant(dependency, "does-not-exist", configuration)
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("resolves the variant from an uppercased, underscored BP_<ID>_VARIANT environment variable", func() {
+			Expect(os.Setenv("BP_BELLSOFT_JDK_VARIANT", "linux-amd64")).To(Succeed())
+
+			key, variant, err := libpak.ResolveDependencyVariant(dependency, "", configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal("linux-amd64"))
+			Expect(variant.SHA256).To(Equal("amd64-sha"))
+		})
+
+		it("fails when the configured variant key does not exist", func() {
+			Expect(os.Setenv("BP_BELLSOFT_JDK_VARIANT", "does-not-exist")).To(Succeed())
+
+			_, _, err := libpak.ResolveDependencyVariant(dependency, "", configuration)
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("honors a configured Default for BP_<ID>_VARIANT even without the environment variable set", func() {
+			configuration = libpak.ConfigurationResolver{
+				Configurations: []libpak.BuildpackConfiguration{
+					{Name: "BP_BELLSOFT_JDK_VARIANT", Default: "linux-arm64"},
+				},
+			}
+
+			key, variant, err := libpak.ResolveDependencyVariant(dependency, "", configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal("linux-arm64"))
+			Expect(variant.SHA256).To(Equal("arm64-sha"))
+		})
+
+		it("falls through to auto-detection when a configured Default names an unknown variant", func() {
+			configuration = libpak.ConfigurationResolver{
+				Configurations: []libpak.BuildpackConfiguration{
+					{Name: "BP_BELLSOFT_JDK_VARIANT", Default: "does-not-exist"},
+				},
+			}
+			single := libpak.BuildpackDependency{
+				ID: "bellsoft-jdk",
+				Variants: map[string]libpak.DependencyVariant{
+					"only": {URI: "https://example.com/only.tgz", SHA256: "only-sha"},
+				},
+			}
+
+			key, variant, err := libpak.ResolveDependencyVariant(single, "", configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal("only"))
+			Expect(variant.SHA256).To(Equal("only-sha"))
+		})
+
+		it("auto-detects the sole variant matching the current runtime", func() {
+			single := libpak.BuildpackDependency{
+				ID: "single-variant",
+				Variants: map[string]libpak.DependencyVariant{
+					"only": {URI: "https://example.com/only.tgz", SHA256: "only-sha"},
+				},
+			}
+
+			key, variant, err := libpak.ResolveDependencyVariant(single, "", configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal("only"))
+			Expect(variant.SHA256).To(Equal("only-sha"))
+		})
+
+		it("fails to auto-detect when more than one variant matches the current runtime", func() {
+			ambiguous := libpak.BuildpackDependency{
+				ID: "bellsoft-jdk",
+				Variants: map[string]libpak.DependencyVariant{
+					"default": {URI: "https://example.com/default.tgz", SHA256: "default-sha"},
+					"musl":    {URI: "https://example.com/musl.tgz", SHA256: "musl-sha"},
+				},
+			}
+
+			_, _, err := libpak.ResolveDependencyVariant(ambiguous, "", configuration)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	context("NewDependencyLayerContributorForVariant", func() {
+		it("records the resolved variant key on ExpectedMetadata and the plan entry", func() {
+			plan := &libcnb.BuildpackPlan{}
+			layer := libcnb.Layer{Path: filepath.Join(t.TempDir(), "test-layer")}
+
+			contributor, err := libpak.NewDependencyLayerContributorForVariant(dependency, "linux-amd64", configuration,
+				libpak.DependencyCache{}, layer, plan)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(contributor.LayerContributor.ExpectedMetadata).To(HaveKeyWithValue("variant", "linux-amd64"))
+			Expect(plan.Entries[0].Metadata).To(HaveKeyWithValue("variant", "linux-amd64"))
+		})
+	})
+}
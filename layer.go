@@ -18,6 +18,7 @@ package libpak
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -107,6 +108,20 @@ type DependencyLayerContributor struct {
 
 	// LayerContributor is the contained LayerContributor used for the actual contribution.
 	LayerContributor LayerContributor
+
+	// DependencyScanner, if set, is invoked against the dependency artifact before the DependencyLayerFunc runs. A
+	// nil DependencyScanner skips scanning entirely.
+	DependencyScanner DependencyScanner
+
+	// Fetch, if set, is used instead of DependencyCache.Artifact to resolve a non-OCI dependency's artifact.
+	// LayerContributorGroup sets this to a singleflight-backed fetch so that DependencyLayerContributors sharing a
+	// Dependency.SHA256 share a single download.
+	Fetch func(BuildpackDependency) (*os.File, error)
+
+	// plan and planEntry point at the BuildpackPlanEntry added by NewDependencyLayerContributor, so that resolving an
+	// oci:// dependency can record its digest and registry host once the reference is actually pulled.
+	plan      *libcnb.BuildpackPlan
+	planEntry int
 }
 
 // NewDependencyLayerContributor creates a new instance and adds the dependency to the Buildpack Plan.
@@ -145,6 +160,8 @@ func NewDependencyLayerContributor(dependency BuildpackDependency, cache Depende
 		Dependency:       dependency,
 		DependencyCache:  cache,
 		LayerContributor: NewLayerContributor(fmt.Sprintf("%s %s", dependency.Name, dependency.Version), expected, layer),
+		plan:             plan,
+		planEntry:        len(plan.Entries) - 1,
 	}
 }
 
@@ -153,16 +170,82 @@ type DependencyLayerFunc func(artifact *os.File, layer libcnb.Layer) (libcnb.Lay
 
 // Contribute is the function to call whe implementing your libcnb.LayerContributor.
 func (d *DependencyLayerContributor) Contribute(f DependencyLayerFunc) (libcnb.Layer, error) {
-	return d.LayerContributor.Contribute(func(layer libcnb.Layer) (libcnb.Layer, error) {
-		artifact, err := d.DependencyCache.Artifact(d.Dependency)
+	var (
+		artifact *os.File
+		findings []DependencyFinding
+	)
+
+	// A configured DependencyScanner must run, and its digest must be folded into ExpectedMetadata, before
+	// LayerContributor.Contribute's cache-hit check runs below. Otherwise an already-cached layer is always reused
+	// without ever re-scanning, so a newly-disclosed CVE on an unchanged dependency would never be detected.
+	if d.DependencyScanner != nil {
+		a, err := d.fetchArtifact()
 		if err != nil {
 			return libcnb.Layer{}, fmt.Errorf("unable to get dependency %s: %w", d.Dependency.ID, err)
 		}
 
+		fs, digest, err := ScanDependency(d.DependencyScanner, a, d.Dependency, d.LayerContributor.logger)
+		if err != nil {
+			return libcnb.Layer{}, err
+		}
+
+		if _, err := a.Seek(0, io.SeekStart); err != nil {
+			return libcnb.Layer{}, fmt.Errorf("unable to reset %s: %w", a.Name(), err)
+		}
+
+		artifact, findings = a, fs
+		if len(findings) > 0 {
+			d.LayerContributor.ExpectedMetadata["dependency-scan-digest"] = digest
+		}
+	}
+
+	return d.LayerContributor.Contribute(func(layer libcnb.Layer) (libcnb.Layer, error) {
+		if artifact == nil {
+			a, err := d.fetchArtifact()
+			if err != nil {
+				return libcnb.Layer{}, fmt.Errorf("unable to get dependency %s: %w", d.Dependency.ID, err)
+			}
+			artifact = a
+		}
+
+		if len(findings) > 0 {
+			if layer.Metadata == nil {
+				layer.Metadata = map[string]interface{}{}
+			}
+			layer.Metadata["dependency-scan-findings"] = findings
+		}
+
 		return f(artifact, layer)
 	})
 }
 
+// fetchArtifact resolves d.Dependency's artifact, routing oci:// URIs through OCIArtifact instead of
+// d.DependencyCache.Artifact (or d.Fetch, if set) so that the digest and registry host OCIArtifact resolves can be
+// recorded on the BuildpackPlan entry added by NewDependencyLayerContributor, keeping cache equivalence checks
+// stable across tag mutations. d.DependencyCache.Artifact also routes oci:// URIs through OCIArtifact on its own,
+// for callers (e.g. LazyDependencyLayerContributor) that reach it without going through this
+// method and so have no plan entry to annotate.
+func (d *DependencyLayerContributor) fetchArtifact() (*os.File, error) {
+	if !IsOCIDependency(d.Dependency) {
+		if d.Fetch != nil {
+			return d.Fetch(d.Dependency)
+		}
+		return d.DependencyCache.Artifact(d.Dependency)
+	}
+
+	artifact, digest, host, err := ociArtifactToTempFile(d.Dependency)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.plan != nil {
+		d.plan.Entries[d.planEntry].Metadata["oci-digest"] = digest
+		d.plan.Entries[d.planEntry].Metadata["oci-registry"] = host
+	}
+
+	return artifact, nil
+}
+
 // HelperLayerContributor is a helper for implementing a libcnb.LayerContributor for a buildpack helper application in
 // order to get consistent logging and avoidance.
 type HelperLayerContributor struct {
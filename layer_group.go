@@ -0,0 +1,220 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/buildpacks/libcnb"
+	"github.com/heroku/color"
+	"github.com/paketoio/libpak/bard"
+	"golang.org/x/sync/singleflight"
+)
+
+// LayerParallelismEnvVar overrides the number of layers that LayerContributorGroup contributes concurrently.
+// Defaults to runtime.GOMAXPROCS(0).
+const LayerParallelismEnvVar = "BP_LAYER_PARALLELISM"
+
+// GroupMember is a single contribution managed by a LayerContributorGroup. Use GroupLayer, GroupDependencyLayer, and
+// GroupHelperLayer to build one from an existing LayerContributor, DependencyLayerContributor, or
+// HelperLayerContributor.
+type GroupMember struct {
+	name string
+	path string
+	run  func(deps *singleflight.Group, out io.Writer) (libcnb.Layer, error)
+}
+
+// GroupLayer adapts a LayerContributor and its LayerFunc into a GroupMember.
+func GroupLayer(contributor LayerContributor, f LayerFunc) GroupMember {
+	return GroupMember{
+		name: contributor.Name,
+		path: contributor.Layer.Path,
+		run: func(_ *singleflight.Group, out io.Writer) (libcnb.Layer, error) {
+			contributor.logger = bard.NewLogger(out)
+			return contributor.Contribute(f)
+		},
+	}
+}
+
+// GroupDependencyLayer adapts a DependencyLayerContributor and its DependencyLayerFunc into a GroupMember. Two
+// GroupMembers built from dependencies that share a non-empty Dependency.SHA256 will share a single
+// DependencyCache.Artifact call; each still gets its own *os.File handle onto that artifact, since its
+// DependencyLayerFunc will read and seek it independently. oci:// dependencies are not shared: each member resolves
+// its own through DependencyLayerContributor's OCI path.
+func GroupDependencyLayer(contributor DependencyLayerContributor, f DependencyLayerFunc) GroupMember {
+	return GroupMember{
+		name: contributor.LayerContributor.Name,
+		path: contributor.LayerContributor.Layer.Path,
+		run: func(deps *singleflight.Group, out io.Writer) (libcnb.Layer, error) {
+			contributor.LayerContributor.logger = bard.NewLogger(out)
+			contributor.DependencyCache.Logger = bard.NewLogger(out)
+			contributor.Fetch = func(dependency BuildpackDependency) (*os.File, error) {
+				// DependencyCache.Artifact never verifies or reuses a cached download when SHA256 is empty - every
+				// call re-downloads. Deduping those on an empty singleflight key would hand one dependency's content
+				// to every other dependency in the group that also lacks a SHA256, so dependencies without one skip
+				// singleflight entirely and fetch independently, same as they would outside a group.
+				if dependency.SHA256 == "" {
+					return contributor.DependencyCache.Artifact(dependency)
+				}
+
+				name, err, _ := deps.Do(dependency.SHA256, func() (interface{}, error) {
+					artifact, err := contributor.DependencyCache.Artifact(dependency)
+					if err != nil {
+						return nil, err
+					}
+					defer artifact.Close()
+
+					return artifact.Name(), nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				return os.Open(name.(string))
+			}
+
+			return contributor.Contribute(f)
+		},
+	}
+}
+
+// GroupHelperLayer adapts a HelperLayerContributor and its HelperLayerFunc into a GroupMember.
+func GroupHelperLayer(contributor HelperLayerContributor, f HelperLayerFunc) GroupMember {
+	return GroupMember{
+		name: contributor.LayerContributor.Name,
+		path: contributor.LayerContributor.Layer.Path,
+		run: func(_ *singleflight.Group, out io.Writer) (libcnb.Layer, error) {
+			contributor.LayerContributor.logger = bard.NewLogger(out)
+			return contributor.Contribute(f)
+		},
+	}
+}
+
+// LayerContributorGroup contributes a set of GroupMembers concurrently, bounded by LayerParallelismEnvVar (or
+// GOMAXPROCS), deduplicating dependency downloads that share the same Dependency.SHA256, and aggregating any
+// failures. Members that share a libcnb.Layer.Path are run one at a time, but different layers extract in parallel.
+type LayerContributorGroup struct {
+
+	// Members is the set of layers to contribute.
+	Members []GroupMember
+
+	logger bard.Logger
+}
+
+// NewLayerContributorGroup creates a new instance.
+func NewLayerContributorGroup(members ...GroupMember) LayerContributorGroup {
+	return LayerContributorGroup{
+		Members: members,
+		logger:  bard.NewLogger(os.Stdout),
+	}
+}
+
+// Contribute runs every member of g.Members concurrently, bounded by parallelism(), and returns the resulting
+// layers in the same order as g.Members. Each member logs into its own in-memory buffer while it runs, so that
+// concurrent "Contributing"/"Reusing" headers (and any body output that follows) never interleave; once a member
+// finishes, its buffered output is flushed to the console as a single contiguous block. If one or more members fail,
+// every half-written layer directory created by the failed members is removed, and the errors are joined into a
+// single error.
+func (g LayerContributorGroup) Contribute() ([]libcnb.Layer, error) {
+	sem := make(chan struct{}, parallelism())
+	deps := &singleflight.Group{}
+
+	layers := make([]libcnb.Layer, len(g.Members))
+	errs := make([]error, len(g.Members))
+	paths := make([]string, len(g.Members))
+
+	var wg sync.WaitGroup
+	var logMutex sync.Mutex
+
+	pathLocks := map[string]*sync.Mutex{}
+	for _, m := range g.Members {
+		if _, ok := pathLocks[m.path]; !ok {
+			pathLocks[m.path] = &sync.Mutex{}
+		}
+	}
+
+	for i, m := range g.Members {
+		i, m := i, m
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var out bytes.Buffer
+			pathLocks[m.path].Lock()
+			layer, err := m.run(deps, &out)
+			pathLocks[m.path].Unlock()
+
+			logMutex.Lock()
+			_, _ = io.Copy(os.Stdout, &out)
+			if err != nil {
+				g.logger.Header("%s: failed", color.RedString(m.name))
+			} else {
+				g.logger.Header("%s: done", color.BlueString(m.name))
+			}
+			logMutex.Unlock()
+
+			if err != nil {
+				errs[i] = fmt.Errorf("unable to contribute %s: %w", m.name, err)
+				paths[i] = m.path
+				return
+			}
+
+			layers[i] = layer
+		}()
+	}
+	wg.Wait()
+
+	var joinable []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if paths[i] != "" {
+			_ = os.RemoveAll(paths[i])
+		}
+
+		joinable = append(joinable, err)
+	}
+
+	if joined := errors.Join(joinable...); joined != nil {
+		return nil, joined
+	}
+
+	return layers, nil
+}
+
+// parallelism returns LayerParallelismEnvVar if set, otherwise runtime.GOMAXPROCS(0).
+func parallelism() int {
+	if v, ok := os.LookupEnv(LayerParallelismEnvVar); ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/buildpacks/libcnb"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/paketoio/libpak"
+	"github.com/paketoio/libpak/bard"
+)
+
+func testLayerGroup(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layersDir string
+	)
+
+	it.Before(func() {
+		layersDir = t.TempDir()
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+	})
+
+	context("LayerContributorGroup", func() {
+		it("joins every member's error so each is still discoverable with errors.Is", func() {
+			errA := errors.New("layer-a failed")
+			errB := errors.New("layer-b failed")
+
+			a := libpak.NewLayerContributor("layer-a", map[string]interface{}{}, libcnb.Layer{Path: filepath.Join(layersDir, "a")})
+			b := libpak.NewLayerContributor("layer-b", map[string]interface{}{}, libcnb.Layer{Path: filepath.Join(layersDir, "b")})
+			c := libpak.NewLayerContributor("layer-c", map[string]interface{}{}, libcnb.Layer{Path: filepath.Join(layersDir, "c")})
+
+			group := libpak.NewLayerContributorGroup(
+				libpak.GroupLayer(a, func(layer libcnb.Layer) (libcnb.Layer, error) { return libcnb.Layer{}, errA }),
+				libpak.GroupLayer(b, func(layer libcnb.Layer) (libcnb.Layer, error) { return libcnb.Layer{}, errB }),
+				libpak.GroupLayer(c, func(layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil }),
+			)
+
+			_, err := group.Contribute()
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, errA)).To(BeTrue())
+			Expect(errors.Is(err, errB)).To(BeTrue())
+		})
+
+		it("removes the half-written layer directory for a failed member but leaves successful ones", func() {
+			a := libpak.NewLayerContributor("layer-a", map[string]interface{}{}, libcnb.Layer{Path: filepath.Join(layersDir, "a")})
+			b := libpak.NewLayerContributor("layer-b", map[string]interface{}{}, libcnb.Layer{Path: filepath.Join(layersDir, "b")})
+
+			group := libpak.NewLayerContributorGroup(
+				libpak.GroupLayer(a, func(layer libcnb.Layer) (libcnb.Layer, error) {
+					return libcnb.Layer{}, fmt.Errorf("boom")
+				}),
+				libpak.GroupLayer(b, func(layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil }),
+			)
+
+			_, err := group.Contribute()
+			Expect(err).To(HaveOccurred())
+
+			Expect(filepath.Join(layersDir, "a")).NotTo(BeADirectory())
+			Expect(filepath.Join(layersDir, "b")).To(BeADirectory())
+		})
+
+		it("shares a single dependency download across members with the same SHA256", func() {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				_, _ = w.Write([]byte("dependency content"))
+			}))
+			defer server.Close()
+
+			cache := libpak.DependencyCache{
+				CachePath:    filepath.Join(layersDir, "cache"),
+				DownloadPath: filepath.Join(layersDir, "download"),
+				Logger:       bard.NewLogger(os.Stderr),
+			}
+
+			dependency := libpak.BuildpackDependency{
+				ID:     "shared-dependency",
+				URI:    server.URL + "/dependency.tgz",
+				SHA256: "744cd0309953ecf0e2b5e8423bf3d5f7afef8ea8b7949a0de51fba6f6230f6a5",
+			}
+
+			plan := &libcnb.BuildpackPlan{}
+			first := libpak.NewDependencyLayerContributor(dependency, cache, libcnb.Layer{Path: filepath.Join(layersDir, "first")}, plan)
+			second := libpak.NewDependencyLayerContributor(dependency, cache, libcnb.Layer{Path: filepath.Join(layersDir, "second")}, plan)
+
+			group := libpak.NewLayerContributorGroup(
+				libpak.GroupDependencyLayer(first, func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil }),
+				libpak.GroupDependencyLayer(second, func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil }),
+			)
+
+			_, err := group.Contribute()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+		})
+
+		it("does not dedup two distinct dependencies that both lack a SHA256", func() {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				_, _ = fmt.Fprintf(w, "content for %s", r.URL.Path)
+			}))
+			defer server.Close()
+
+			cache := libpak.DependencyCache{
+				CachePath:    filepath.Join(layersDir, "cache"),
+				DownloadPath: filepath.Join(layersDir, "download"),
+				Logger:       bard.NewLogger(os.Stderr),
+			}
+
+			first := libpak.BuildpackDependency{ID: "first-dependency", URI: server.URL + "/first.tgz"}
+			second := libpak.BuildpackDependency{ID: "second-dependency", URI: server.URL + "/second.tgz"}
+
+			plan := &libcnb.BuildpackPlan{}
+			firstContributor := libpak.NewDependencyLayerContributor(first, cache, libcnb.Layer{Path: filepath.Join(layersDir, "first")}, plan)
+			secondContributor := libpak.NewDependencyLayerContributor(second, cache, libcnb.Layer{Path: filepath.Join(layersDir, "second")}, plan)
+
+			var firstContent, secondContent string
+			group := libpak.NewLayerContributorGroup(
+				libpak.GroupDependencyLayer(firstContributor, func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) {
+					b, err := io.ReadAll(artifact)
+					Expect(err).NotTo(HaveOccurred())
+					firstContent = string(b)
+					return layer, nil
+				}),
+				libpak.GroupDependencyLayer(secondContributor, func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) {
+					b, err := io.ReadAll(artifact)
+					Expect(err).NotTo(HaveOccurred())
+					secondContent = string(b)
+					return layer, nil
+				}),
+			)
+
+			_, err := group.Contribute()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+			Expect(firstContent).To(Equal("content for /first.tgz"))
+			Expect(secondContent).To(Equal("content for /second.tgz"))
+		})
+	})
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildpacks/libcnb"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/paketoio/libpak"
+)
+
+func testLayer(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("DependencyLayerContributor", func() {
+		it("removes the temporary file it creates to resolve an oci:// dependency", func() {
+			server := httptest.NewServer(registry.New())
+			defer server.Close()
+
+			host := strings.TrimPrefix(server.URL, "http://")
+			ref := fmt.Sprintf("%s/test/repo:latest", host)
+
+			image, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			tag, err := name.NewTag(ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(tag, image)).To(Succeed())
+
+			layers, err := image.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			diffID, err := layers[0].DiffID()
+			Expect(err).NotTo(HaveOccurred())
+
+			dependency := libpak.BuildpackDependency{
+				ID:     "test-dependency",
+				URI:    fmt.Sprintf("oci://%s", ref),
+				SHA256: diffID.Hex,
+			}
+
+			before, err := filepath.Glob(filepath.Join(os.TempDir(), "oci-dependency-*"))
+			Expect(err).NotTo(HaveOccurred())
+
+			layersDir := t.TempDir()
+			plan := &libcnb.BuildpackPlan{}
+			contributor := libpak.NewDependencyLayerContributor(dependency, libpak.DependencyCache{}, libcnb.Layer{Path: filepath.Join(layersDir, "test-layer")}, plan)
+
+			_, err = contributor.Contribute(func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) {
+				return layer, nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			after, err := filepath.Glob(filepath.Join(os.TempDir(), "oci-dependency-*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(after).To(HaveLen(len(before)))
+		})
+	})
+}
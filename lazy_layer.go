@@ -0,0 +1,253 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/buildpacks/libcnb"
+	"github.com/heroku/color"
+	"github.com/mitchellh/mapstructure"
+)
+
+// stargzTOCName is the sidecar file the contributor writes into the layer directory alongside the directory
+// skeleton, so the launch-time fetcher knows where each file's chunks live.
+const stargzTOCName = ".stargz-toc.json"
+
+// StargzTOC is the `stargz.index.json` trailer of an eStargz artifact, mapping each file path to the chunk(s)
+// needed to materialize it on demand.
+type StargzTOC struct {
+
+	// Digest is the digest of the TOC itself, used to make cache reuse deterministic.
+	Digest string `json:"digest"`
+
+	// Entries describes every file, directory, and chunk in the artifact.
+	Entries []StargzTOCEntry `json:"entries"`
+}
+
+// StargzTOCEntry is a single entry in a StargzTOC.
+type StargzTOCEntry struct {
+
+	// Name is the file path, relative to the layer root.
+	Name string `json:"name"`
+
+	// Type is "dir", "reg", or "chunk".
+	Type string `json:"type"`
+
+	// Offset is the compressed byte offset of the chunk within the artifact.
+	Offset int64 `json:"offset"`
+
+	// ChunkSize is the compressed size of the chunk.
+	ChunkSize int64 `json:"chunkSize,omitempty"`
+
+	// ChunkDigest is the digest of the chunk's uncompressed content. It is verified by the launch-time fetcher that
+	// actually retrieves the chunk, not by this contributor, which only ever sees the TOC.
+	ChunkDigest string `json:"chunkDigest,omitempty"`
+
+	// Size is the uncompressed size of the file.
+	Size int64 `json:"size,omitempty"`
+}
+
+// LazyDependencyLayerContributor is a sibling of DependencyLayerContributor that, given an eStargz-formatted
+// dependency, writes only the directory skeleton and a stargz TOC sidecar into the layer rather than expanding the
+// artifact eagerly. Files are fetched in chunks, by path, the first time the app or a launch-time helper opens them.
+type LazyDependencyLayerContributor struct {
+
+	// Dependency is the dependency being contributed.
+	Dependency BuildpackDependency
+
+	// DependencyCache is the cache to use to get the dependency.
+	DependencyCache DependencyCache
+
+	// LayerContributor is the contained LayerContributor used for the actual contribution.
+	LayerContributor LayerContributor
+}
+
+// NewLazyDependencyLayerContributor creates a new instance and adds the dependency to the Buildpack Plan.
+func NewLazyDependencyLayerContributor(dependency BuildpackDependency, cache DependencyCache, layer libcnb.Layer,
+	plan *libcnb.BuildpackPlan) LazyDependencyLayerContributor {
+
+	delegate := NewDependencyLayerContributor(dependency, cache, layer, plan)
+
+	return LazyDependencyLayerContributor{
+		Dependency:       dependency,
+		DependencyCache:  cache,
+		LayerContributor: delegate.LayerContributor,
+	}
+}
+
+// LazyDependencyLayerFunc is a callback function that is invoked once the directory skeleton has been materialized,
+// so that the caller can write launch-time configuration that points at the sidecar TOC.
+type LazyDependencyLayerFunc func(toc StargzTOC, layer libcnb.Layer) (libcnb.Layer, error)
+
+// Contribute is the function to call when implementing your libcnb.LayerContributor. If the artifact does not end
+// with a stargz TOC footer, it falls back to materializing eagerly via f. The fetcher that resolves individual
+// chunks at launch time, including the per-chunk digest verification described on StargzTOCEntry.ChunkDigest, is
+// shipped separately with the buildpack; this contributor is only responsible for the directory skeleton and sidecar.
+//
+// Before fetching anything, Contribute checks whether the layer already on disk matches the dependency identity
+// fields (id/name/version/uri/sha256/stacks/licenses) that NewDependencyLayerContributor seeds ExpectedMetadata
+// with. Those fields can only change when the dependency itself changes - at which point its SHA256 changes too -
+// so a match there means the stargz-toc-digest and skeleton an earlier build already wrote are still good, without
+// needing to download and decompress the artifact just to recompute a digest that's guaranteed to come out the
+// same. Only a miss here - a version or URI bump - falls through to fetching the artifact and folding its TOC
+// digest into ExpectedMetadata before LayerContributor.Contribute's own cache-hit comparison runs, the same way
+// DependencyLayerContributor folds in its scan digest: doing this inside the closure passed to Contribute would be
+// too late, since by then the comparison - and so the decision to skip rewriting the skeleton - has already been
+// made against an ExpectedMetadata that never had a digest key.
+func (l *LazyDependencyLayerContributor) Contribute(f LazyDependencyLayerFunc, eager DependencyLayerFunc) (libcnb.Layer, error) {
+	if l.unchanged() {
+		l.LayerContributor.logger.Header("%s: %s cached layer", color.BlueString(l.LayerContributor.Name), color.GreenString("Reusing"))
+		return l.LayerContributor.Layer, nil
+	}
+
+	artifact, err := l.DependencyCache.Artifact(l.Dependency)
+	if err != nil {
+		return libcnb.Layer{}, fmt.Errorf("unable to get dependency %s: %w", l.Dependency.ID, err)
+	}
+
+	toc, err := readStargzTOC(artifact)
+	if err != nil {
+		return libcnb.Layer{}, fmt.Errorf("unable to read stargz TOC for %s: %w", l.Dependency.ID, err)
+	}
+
+	if toc != nil {
+		l.LayerContributor.ExpectedMetadata["stargz-toc-digest"] = toc.Digest
+	}
+
+	return l.LayerContributor.Contribute(func(layer libcnb.Layer) (libcnb.Layer, error) {
+		if toc == nil {
+			return eager(artifact, layer)
+		}
+
+		if err := writeSkeleton(layer.Path, *toc); err != nil {
+			return libcnb.Layer{}, err
+		}
+
+		sidecar, err := os.Create(filepath.Join(layer.Path, stargzTOCName))
+		if err != nil {
+			return libcnb.Layer{}, fmt.Errorf("unable to create %s: %w", stargzTOCName, err)
+		}
+		defer sidecar.Close()
+
+		if err := json.NewEncoder(sidecar).Encode(toc); err != nil {
+			return libcnb.Layer{}, fmt.Errorf("unable to write %s: %w", stargzTOCName, err)
+		}
+
+		return f(*toc, layer)
+	})
+}
+
+// unchanged reports whether the layer already on disk matches l.LayerContributor.ExpectedMetadata as it stands
+// before a TOC digest is folded in, i.e. whether the dependency itself is unchanged since the layer was last
+// contributed. It deliberately ignores any extra keys (like stargz-toc-digest) the stored metadata has that
+// ExpectedMetadata doesn't yet, unlike LayerContributor.Contribute's own comparison, which requires an exact match.
+func (l *LazyDependencyLayerContributor) unchanged() bool {
+	if len(l.LayerContributor.Layer.Metadata) == 0 {
+		return false
+	}
+
+	var actual map[string]interface{}
+	if err := mapstructure.Decode(l.LayerContributor.Layer.Metadata, &actual); err != nil {
+		return false
+	}
+
+	var expected map[string]interface{}
+	if err := mapstructure.Decode(l.LayerContributor.ExpectedMetadata, &expected); err != nil {
+		return false
+	}
+
+	for k, v := range expected {
+		if !reflect.DeepEqual(actual[k], v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readStargzTOC reads the eStargz TOC footer from artifact, or returns a nil StargzTOC if the artifact has no TOC
+// footer, so that the caller can fall back to eager materialization.
+func readStargzTOC(artifact *os.File) (*StargzTOC, error) {
+	footer, err := readStargzFooter(artifact)
+	if err != nil {
+		return nil, err
+	}
+
+	if footer == nil {
+		return nil, nil
+	}
+
+	toc := &StargzTOC{}
+	if err := json.Unmarshal(footer, toc); err != nil {
+		return nil, fmt.Errorf("unable to decode stargz TOC: %w", err)
+	}
+
+	return toc, nil
+}
+
+// writeSkeleton creates every directory named in toc and a zero-length placeholder for every regular file, so the
+// layer's file tree is populated without fetching file contents. Entries are confined to root: a TOC entry whose
+// name is absolute or escapes root via ".." (e.g. from a crafted or compromised artifact) is rejected instead of
+// being written outside the layer directory.
+func writeSkeleton(root string, toc StargzTOC) error {
+	for _, entry := range toc.Entries {
+		path, err := safeJoin(root, entry.Name)
+		if err != nil {
+			return err
+		}
+
+		switch entry.Type {
+		case "dir":
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return fmt.Errorf("unable to create directory %s: %w", path, err)
+			}
+		case "reg":
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("unable to create directory %s: %w", filepath.Dir(path), err)
+			}
+
+			f, err := os.Create(path)
+			if err != nil {
+				return fmt.Errorf("unable to create %s: %w", path, err)
+			}
+			_ = f.Close()
+		}
+	}
+
+	return nil
+}
+
+// safeJoin joins root and name the way filepath.Join does, but rejects an absolute name or one whose cleaned path
+// escapes root, so a TOC entry like "../../etc/cron.d/evil" can't be used to write outside the layer directory.
+func safeJoin(root string, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("stargz TOC entry %q is absolute", name)
+	}
+
+	path := filepath.Join(root, name)
+	if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("stargz TOC entry %q escapes the layer directory", name)
+	}
+
+	return path, nil
+}
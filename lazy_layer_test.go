@@ -0,0 +1,253 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/libcnb"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/paketoio/libpak"
+	"github.com/paketoio/libpak/bard"
+)
+
+// estargzFixture builds a minimal gzip tar whose only entry is an eStargz TOC footer.
+func estargzFixture(t *testing.T, toc libpak.StargzTOC) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(toc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	if err := tw.WriteHeader(&tar.Header{Name: "stargz.index.json", Size: int64(len(b)), Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func testLazyLayer(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server    *httptest.Server
+		layersDir string
+		layer     libcnb.Layer
+		cache     libpak.DependencyCache
+	)
+
+	it.Before(func() {
+		layersDir = t.TempDir()
+		layer.Path = filepath.Join(layersDir, "test-layer")
+		layer.Metadata = map[string]interface{}{}
+
+		cache = libpak.DependencyCache{
+			CachePath:    filepath.Join(layersDir, "cache"),
+			DownloadPath: filepath.Join(layersDir, "download"),
+			Logger:       bard.NewLogger(io.Discard),
+		}
+	})
+
+	it.After(func() {
+		if server != nil {
+			server.Close()
+		}
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+	})
+
+	context("LazyDependencyLayerContributor", func() {
+		it("folds the TOC digest into ExpectedMetadata and writes the skeleton and sidecar", func() {
+			toc := libpak.StargzTOC{
+				Digest: "sha256:test-toc-digest",
+				Entries: []libpak.StargzTOCEntry{
+					{Name: "lib", Type: "dir"},
+					{Name: "lib/app.jar", Type: "reg", Size: 1024},
+				},
+			}
+			artifact := estargzFixture(t, toc)
+			sum := sha256.Sum256(artifact)
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(artifact)
+			}))
+
+			dependency := libpak.BuildpackDependency{
+				ID:     "test-dependency",
+				URI:    server.URL + "/dependency.tar.gz",
+				SHA256: hex.EncodeToString(sum[:]),
+			}
+
+			plan := &libcnb.BuildpackPlan{}
+			contributor := libpak.NewLazyDependencyLayerContributor(dependency, cache, layer, plan)
+
+			_, err := contributor.Contribute(
+				func(toc libpak.StargzTOC, layer libcnb.Layer) (libcnb.Layer, error) {
+					return layer, nil
+				},
+				func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) {
+					t.Fatal("expected lazy materialization, not eager fallback")
+					return layer, nil
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(contributor.LayerContributor.ExpectedMetadata).To(HaveKeyWithValue("stargz-toc-digest", "sha256:test-toc-digest"))
+
+			Expect(filepath.Join(layer.Path, "lib")).To(BeADirectory())
+			Expect(filepath.Join(layer.Path, "lib", "app.jar")).To(BeAnExistingFile())
+			Expect(filepath.Join(layer.Path, ".stargz-toc.json")).To(BeAnExistingFile())
+		})
+
+		it("falls back to eager materialization when the artifact has no TOC footer", func() {
+			artifact := []byte("not a stargz artifact")
+			sum := sha256.Sum256(artifact)
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(artifact)
+			}))
+
+			dependency := libpak.BuildpackDependency{
+				ID:     "test-dependency",
+				URI:    server.URL + "/dependency.tar.gz",
+				SHA256: hex.EncodeToString(sum[:]),
+			}
+
+			plan := &libcnb.BuildpackPlan{}
+			contributor := libpak.NewLazyDependencyLayerContributor(dependency, cache, layer, plan)
+
+			var called bool
+			_, err := contributor.Contribute(
+				func(toc libpak.StargzTOC, layer libcnb.Layer) (libcnb.Layer, error) {
+					t.Fatal("expected eager fallback, not lazy materialization")
+					return layer, nil
+				},
+				func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) {
+					called = true
+
+					b, err := io.ReadAll(artifact)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(Equal([]byte("not a stargz artifact")))
+
+					return layer, nil
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(called).To(BeTrue())
+		})
+
+		it("reuses a cached layer instead of rewriting the skeleton", func() {
+			toc := libpak.StargzTOC{
+				Digest:  "sha256:test-toc-digest",
+				Entries: []libpak.StargzTOCEntry{{Name: "lib/app.jar", Type: "reg", Size: 1024}},
+			}
+			artifact := estargzFixture(t, toc)
+			sum := sha256.Sum256(artifact)
+
+			var requests int
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				_, _ = w.Write(artifact)
+			}))
+
+			dependency := libpak.BuildpackDependency{
+				ID:     "test-dependency",
+				URI:    server.URL + "/dependency.tar.gz",
+				SHA256: hex.EncodeToString(sum[:]),
+			}
+
+			plan := &libcnb.BuildpackPlan{}
+			contributor := libpak.NewLazyDependencyLayerContributor(dependency, cache, layer, plan)
+			contributor.LayerContributor.Layer.Metadata = map[string]interface{}{"stargz-toc-digest": "sha256:test-toc-digest"}
+			for k, v := range contributor.LayerContributor.ExpectedMetadata {
+				contributor.LayerContributor.Layer.Metadata[k] = v
+			}
+
+			var called bool
+			_, err := contributor.Contribute(
+				func(toc libpak.StargzTOC, layer libcnb.Layer) (libcnb.Layer, error) {
+					called = true
+					return layer, nil
+				},
+				func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil },
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(called).To(BeFalse())
+
+			Expect(filepath.Join(layer.Path, "lib")).NotTo(BeADirectory())
+
+			Expect(requests).To(Equal(0), "dependency identity was unchanged; the artifact should never have been fetched")
+		})
+
+		it("rejects a TOC entry that escapes the layer directory", func() {
+			toc := libpak.StargzTOC{
+				Digest:  "sha256:test-toc-digest",
+				Entries: []libpak.StargzTOCEntry{{Name: "../../etc/cron.d/evil", Type: "reg", Size: 1}},
+			}
+			artifact := estargzFixture(t, toc)
+			sum := sha256.Sum256(artifact)
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(artifact)
+			}))
+
+			dependency := libpak.BuildpackDependency{
+				ID:     "test-dependency",
+				URI:    server.URL + "/dependency.tar.gz",
+				SHA256: hex.EncodeToString(sum[:]),
+			}
+
+			plan := &libcnb.BuildpackPlan{}
+			contributor := libpak.NewLazyDependencyLayerContributor(dependency, cache, layer, plan)
+
+			_, err := contributor.Contribute(
+				func(toc libpak.StargzTOC, layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil },
+				func(artifact *os.File, layer libcnb.Layer) (libcnb.Layer, error) { return layer, nil },
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("escapes the layer directory"))
+
+			Expect(filepath.Join(layersDir, "etc")).NotTo(BeADirectory())
+		})
+	})
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// OCIRegistryAuthEnvVar is the environment variable used to override authn.DefaultKeychain resolution for a
+// dependency's registry host. The value has the form "<username>:<password>".
+const OCIRegistryAuthEnvVar = "BP_OCI_REGISTRY_AUTH"
+
+// IsOCIDependency indicates whether a BuildpackDependency.URI refers to an OCI image or artifact rather than an
+// http(s):// location.
+func IsOCIDependency(dependency BuildpackDependency) bool {
+	return strings.HasPrefix(dependency.URI, "oci://")
+}
+
+// OCIArtifact resolves dependency.URI as an OCI reference, selects the layer named by the dependency's
+// layer-media-type or layer-index metadata, verifies its digest against dependency.SHA256, and streams it to
+// destination. It returns the opened file along with the resolved digest and registry host, which callers should
+// fold into plan entry and ExpectedMetadata so cache equivalence checks stay stable across tag mutations. It is
+// invoked from DependencyCache.Artifact whenever IsOCIDependency reports true.
+func OCIArtifact(dependency BuildpackDependency, destination string) (*os.File, string, string, error) {
+	return ociArtifact(dependency, destination)
+}
+
+// ociArtifactToTempFile is OCIArtifact, but manages its own temporary destination file instead of requiring the
+// caller to provide one. DependencyCache.Artifact and DependencyLayerContributor.fetchArtifact both use this so
+// that an oci:// dependency never falls through to downloadTo's http(s)-only client.
+func ociArtifactToTempFile(dependency BuildpackDependency) (*os.File, string, string, error) {
+	destination, err := os.CreateTemp("", "oci-dependency-*")
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	destination.Close()
+
+	artifact, digest, host, err := ociArtifact(dependency, destination.Name())
+	// The temporary file is unlinked as soon as ociArtifact is done writing to it: artifact (or the error path
+	// above) is the only thing that still needs it, and an open file descriptor keeps its content readable until
+	// artifact is closed, so this doesn't leak a temp file for the life of the build container.
+	_ = os.Remove(destination.Name())
+
+	return artifact, digest, host, err
+}
+
+func ociArtifact(dependency BuildpackDependency, destination string) (*os.File, string, string, error) {
+	ref, err := name.ParseReference(strings.TrimPrefix(dependency.URI, "oci://"))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to parse OCI reference %s: %w", dependency.URI, err)
+	}
+
+	keychain, err := ociKeychain(ref.Context().RegistryStr())
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	image, err := remote.Image(ref, remote.WithAuthFromKeychain(keychain))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to pull %s: %w", ref, err)
+	}
+
+	layer, err := ociSelectLayer(image, dependency)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to determine layer digest for %s: %w", ref, err)
+	}
+
+	file, err := os.Create(destination)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to create %s: %w", destination, err)
+	}
+	defer file.Close()
+
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to read layer %s from %s: %w", digest, ref, err)
+	}
+	defer rc.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, sum), rc); err != nil {
+		return nil, "", "", fmt.Errorf("unable to write %s: %w", destination, err)
+	}
+
+	if actual := hex.EncodeToString(sum.Sum(nil)); dependency.SHA256 != "" && !strings.EqualFold(actual, dependency.SHA256) {
+		return nil, "", "", fmt.Errorf("dependency sha256 mismatch: expected %s, actual %s", dependency.SHA256, actual)
+	}
+
+	in, err := os.Open(destination)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to open %s: %w", destination, err)
+	}
+
+	return in, digest.String(), ref.Context().RegistryStr(), nil
+}
+
+// ociKeychain resolves authn.DefaultKeychain, unless OCIRegistryAuthEnvVar is set, in which case it is parsed as
+// "<username>:<password>" and scoped to host.
+func ociKeychain(host string) (authn.Keychain, error) {
+	auth, ok := os.LookupEnv(OCIRegistryAuthEnvVar)
+	if !ok {
+		return authn.DefaultKeychain, nil
+	}
+
+	username, password, found := strings.Cut(auth, ":")
+	if !found {
+		return nil, fmt.Errorf("unable to parse %s, expected <username>:<password>", OCIRegistryAuthEnvVar)
+	}
+
+	return staticKeychain{host: host, auth: authn.FromConfig(authn.AuthConfig{Username: username, Password: password})}, nil
+}
+
+type staticKeychain struct {
+	host string
+	auth authn.Authenticator
+}
+
+func (s staticKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if target.RegistryStr() != s.host {
+		return authn.Anonymous, nil
+	}
+
+	return s.auth, nil
+}
+
+// ociSelectLayer picks the layer named by dependency.Metadata["layer-media-type"] or
+// dependency.Metadata["layer-index"], defaulting to index 0 when neither is set.
+func ociSelectLayer(image v1.Image, dependency BuildpackDependency) (v1.Layer, error) {
+	layers, err := image.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list layers: %w", err)
+	}
+
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("%s has no layers", dependency.URI)
+	}
+
+	if mediaType, ok := dependency.Metadata["layer-media-type"].(string); ok {
+		for _, l := range layers {
+			mt, err := l.MediaType()
+			if err != nil {
+				return nil, fmt.Errorf("unable to determine layer media type: %w", err)
+			}
+
+			if string(mt) == mediaType {
+				return l, nil
+			}
+		}
+
+		return nil, fmt.Errorf("no layer with media type %s in %s", mediaType, dependency.URI)
+	}
+
+	index := 0
+	if i, ok := dependency.Metadata["layer-index"]; ok {
+		n, err := toLayerIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse layer-index %v: %w", i, err)
+		}
+		index = n
+	}
+
+	if index < 0 || index >= len(layers) {
+		return nil, fmt.Errorf("layer-index %d out of range for %d layers in %s", index, len(layers), dependency.URI)
+	}
+
+	return layers[index], nil
+}
+
+func toLayerIndex(i interface{}) (int, error) {
+	switch v := i.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	default:
+		return 0, fmt.Errorf("unsupported layer-index type %T", i)
+	}
+}
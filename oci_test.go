@@ -0,0 +1,175 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/paketoio/libpak"
+)
+
+func testOCI(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server   *httptest.Server
+		destFile *os.File
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+
+		var err error
+		destFile, err = os.CreateTemp("", "oci-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destFile.Close()).To(Succeed())
+	})
+
+	it.After(func() {
+		server.Close()
+		Expect(os.RemoveAll(destFile.Name())).To(Succeed())
+	})
+
+	context("IsOCIDependency", func() {
+		it("is true for an oci:// URI", func() {
+			Expect(libpak.IsOCIDependency(libpak.BuildpackDependency{URI: "oci://registry/repo:tag"})).To(BeTrue())
+		})
+
+		it("is false for an http(s):// URI", func() {
+			Expect(libpak.IsOCIDependency(libpak.BuildpackDependency{URI: "https://example.com/dep.tgz"})).To(BeFalse())
+		})
+	})
+
+	context("OCIArtifact", func() {
+		var (
+			ref        string
+			dependency libpak.BuildpackDependency
+		)
+
+		it.Before(func() {
+			host := strings.TrimPrefix(server.URL, "http://")
+			ref = fmt.Sprintf("%s/test/repo:latest", host)
+
+			image, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			tag, err := name.NewTag(ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(tag, image)).To(Succeed())
+
+			layers, err := image.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layers).To(HaveLen(1))
+
+			diffID, err := layers[0].DiffID()
+			Expect(err).NotTo(HaveOccurred())
+
+			dependency = libpak.BuildpackDependency{
+				URI:    fmt.Sprintf("oci://%s", ref),
+				SHA256: diffID.Hex,
+			}
+		})
+
+		it("pulls the referenced layer and verifies its digest", func() {
+			file, digest, host, err := libpak.OCIArtifact(dependency, destFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			Expect(digest).NotTo(BeEmpty())
+			Expect(host).To(Equal(strings.TrimPrefix(server.URL, "http://")))
+
+			info, err := file.Stat()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically(">", 0))
+		})
+
+		it("returns an error when the expected SHA256 does not match", func() {
+			dependency.SHA256 = strings.Repeat("0", 64)
+
+			_, _, _, err := libpak.OCIArtifact(dependency, destFile.Name())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("sha256 mismatch"))
+		})
+
+		it("selects a layer by index", func() {
+			image, err := random.Image(512, 2)
+			Expect(err).NotTo(HaveOccurred())
+
+			tag, err := name.NewTag(ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(tag, image)).To(Succeed())
+
+			layers, err := image.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layers).To(HaveLen(2))
+
+			diffID, err := layers[1].DiffID()
+			Expect(err).NotTo(HaveOccurred())
+
+			dependency.SHA256 = diffID.Hex
+			dependency.Metadata = map[string]interface{}{"layer-index": 1}
+
+			_, _, _, err = libpak.OCIArtifact(dependency, destFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	context("DependencyCache.Artifact with an oci:// URI", func() {
+		it("resolves the dependency via OCIArtifact instead of downloading it over http(s)", func() {
+			host := strings.TrimPrefix(server.URL, "http://")
+			ref := fmt.Sprintf("%s/test/cache-repo:latest", host)
+
+			image, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			tag, err := name.NewTag(ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(tag, image)).To(Succeed())
+
+			layers, err := image.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layers).To(HaveLen(1))
+
+			diffID, err := layers[0].DiffID()
+			Expect(err).NotTo(HaveOccurred())
+
+			dependency := libpak.BuildpackDependency{
+				URI:    fmt.Sprintf("oci://%s", ref),
+				SHA256: diffID.Hex,
+			}
+
+			file, err := libpak.DependencyCache{}.Artifact(dependency)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			info, err := file.Stat()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically(">", 0))
+		})
+	})
+}
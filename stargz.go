@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018-2020 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libpak
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// stargzTOCEntryName is the name eStargz gives the last tar entry, which holds the JSON TOC rather than file
+// content.
+const stargzTOCEntryName = "stargz.index.json"
+
+// readStargzFooter scans artifact for a tar entry named stargzTOCEntryName, at any position (the last one wins if
+// there are several), and returns its raw JSON bytes,
+// or nil if the artifact isn't eStargz-formatted (no such entry, or not a gzip tar at all).
+//
+// Real eStargz readers locate the TOC with a constant-time range read of the trailing footer, without touching the
+// rest of the artifact. This implementation instead decompresses and walks the tar sequentially from the start, so
+// a build that does need to fetch the artifact - an unseen dependency, or a version/URI bump that
+// LazyDependencyLayerContributor.unchanged didn't already short-circuit - pays for a full decompress just to find
+// the TOC, undercutting some of the layer-build speedup lazy materialization is meant to provide. Fixing this
+// requires reading gzip members from the end of the stream (as estargz's gzip.Reader variant does), not a
+// constant-size trailing read like zip's central directory.
+func readStargzFooter(artifact *os.File) ([]byte, error) {
+	if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("unable to seek %s: %w", artifact.Name(), err)
+	}
+	defer artifact.Seek(0, io.SeekStart)
+
+	gz, err := gzip.NewReader(artifact)
+	if err != nil {
+		// not a gzip artifact at all; caller falls back to eager materialization
+		return nil, nil
+	}
+	defer gz.Close()
+
+	var footer []byte
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// not a well-formed tar; caller falls back to eager materialization
+			return nil, nil
+		}
+
+		if header.Name == stargzTOCEntryName {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %w", stargzTOCEntryName, err)
+			}
+			footer = b
+		}
+	}
+
+	return footer, nil
+}